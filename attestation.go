@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// provenanceOptions holds the parsed `--provenance=k=v,...` flag value.
+// mode mirrors buildkit/buildx: "min" records only what's cheap to compute,
+// "max" additionally records build args, sources, and the full LLB definition.
+type provenanceOptions struct {
+	mode string
+}
+
+// sbomOptions holds the parsed `--sbom=k=v,...` flag value. generator is an
+// image ref that implements the BuildKit SBOM scanner frontend contract.
+type sbomOptions struct {
+	generator string
+}
+
+const inTotoMediaType = "application/vnd.in-toto+json"
+
+func parseAttrs(value string) (map[string]string, error) {
+	attrs := map[string]string{}
+	if value == "" {
+		return attrs, nil
+	}
+
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid attribute %q: expected key=value", field)
+		}
+		attrs[parts[0]] = parts[1]
+	}
+
+	return attrs, nil
+}
+
+func parseProvenanceOptions(value string) (*provenanceOptions, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	attrs, err := parseAttrs(value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --provenance: %v", err)
+	}
+
+	mode := attrs["mode"]
+	if mode == "" {
+		mode = "max"
+	}
+	switch mode {
+	case "min", "max":
+	default:
+		return nil, fmt.Errorf("unsupported --provenance mode %q", mode)
+	}
+
+	return &provenanceOptions{mode: mode}, nil
+}
+
+func parseSBOMOptions(value string) (*sbomOptions, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	attrs, err := parseAttrs(value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --sbom: %v", err)
+	}
+
+	generator := attrs["generator"]
+	if generator == "" {
+		return nil, fmt.Errorf("--sbom requires generator=<image>")
+	}
+
+	return &sbomOptions{generator: generator}, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseProvenanceOptions(t *testing.T) {
+	opts, err := parseProvenanceOptions("mode=max")
+	if err != nil {
+		t.Fatalf("parseProvenanceOptions returned unexpected error: %v", err)
+	}
+	if opts == nil || opts.mode != "max" {
+		t.Fatalf("unexpected provenance options: %+v", opts)
+	}
+
+	if opts, err := parseProvenanceOptions(""); err != nil || opts != nil {
+		t.Fatalf("expected nil, nil for an empty --provenance value, got %+v, %v", opts, err)
+	}
+
+	if _, err := parseProvenanceOptions("mode=bogus"); err == nil {
+		t.Fatal("expected an error for an unsupported --provenance mode, got nil")
+	}
+}
+
+func TestParseSBOMOptions(t *testing.T) {
+	opts, err := parseSBOMOptions("generator=docker/buildkit-syft-scanner:stable-1")
+	if err != nil {
+		t.Fatalf("parseSBOMOptions returned unexpected error: %v", err)
+	}
+	if opts == nil || opts.generator != "docker/buildkit-syft-scanner:stable-1" {
+		t.Fatalf("unexpected sbom options: %+v", opts)
+	}
+
+	if _, err := parseSBOMOptions("mode=max"); err == nil {
+		t.Fatal("expected an error when --sbom is missing generator=, got nil")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+)
+
+const buildHelp = `Build an image from a Dockerfile.`
+
+// stringSlice is a slice of strings that satisfies flag.Value so a flag can
+// be passed multiple times on the command line.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return fmt.Sprintf("%s", *s)
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type buildCommand struct {
+	buildArgs          stringSlice
+	tags               stringSlice
+	labels             stringSlice
+	secrets            stringSlice
+	ssh                stringSlice
+	platforms          stringSlice
+	target             string
+	dockerfilePath     string
+	output             string
+	noCache            bool
+	noConsole          bool
+	buildContextSubdir string
+
+	// cacheFrom and cacheTo hold the raw `--cache-from`/`--cache-to`
+	// values, e.g. "type=registry,ref=foo" or "type=local,src=/path".
+	cacheFrom stringSlice
+	cacheTo   stringSlice
+
+	// buildContexts holds the raw `--build-context name=source` values,
+	// letting a Dockerfile's `FROM name`/`COPY --from=name` resolve to
+	// something other than an earlier build stage.
+	buildContexts stringSlice
+
+	provenance string
+	sbom       string
+
+	network string
+
+	sourceDateEpoch string
+
+	progress string
+}
+
+func (cmd *buildCommand) Name() string      { return "build" }
+func (cmd *buildCommand) Args() string      { return "[OPTIONS] PATH | URL | -" }
+func (cmd *buildCommand) ShortHelp() string { return buildHelp }
+func (cmd *buildCommand) LongHelp() string  { return buildHelp }
+func (cmd *buildCommand) Hidden() bool      { return false }
+
+func (cmd *buildCommand) Register(fs *flag.FlagSet) {
+	fs.Var(&cmd.tags, "t", "Name and optionally a tag in the 'name:tag' format")
+	fs.StringVar(&cmd.dockerfilePath, "f", "", "Name of the Dockerfile (default: 'PATH/Dockerfile')")
+	fs.StringVar(&cmd.target, "target", "", "Set the target build stage to build")
+	fs.Var(&cmd.buildArgs, "build-arg", "Set build-time variables")
+	fs.Var(&cmd.labels, "label", "Set metadata for an image")
+	fs.Var(&cmd.secrets, "secret", "Secret file to expose to the build: id=mysecret,src=/local/secret")
+	fs.Var(&cmd.ssh, "ssh", "SSH agent socket or keys to expose to the build: default|<id>[=<socket>|<key>[,<key>]]")
+	fs.Var(&cmd.platforms, "platform", "Set platform for the image")
+	fs.StringVar(&cmd.output, "o", "", "Output destination (format: type=local,dest=path)")
+	fs.BoolVar(&cmd.noCache, "no-cache", false, "Do not use cache when building the image")
+
+	fs.Var(&cmd.cacheFrom, "cache-from", "External cache sources (e.g. user/app:cache, type=local,src=path/to/dir)")
+	fs.Var(&cmd.cacheTo, "cache-to", "Cache export destinations (e.g. user/app:cache, type=local,dest=path/to/dir)")
+
+	fs.StringVar(&cmd.buildContextSubdir, "build-context-subdir", "", "Subdirectory of a git or tarball remote context to use as the build context")
+
+	fs.Var(&cmd.buildContexts, "build-context", "Additional build contexts (e.g. name=path, name=docker-image://<image>, name=git://...)")
+
+	fs.StringVar(&cmd.provenance, "provenance", "", "Add a SLSA provenance attestation (e.g. mode=max)")
+	fs.StringVar(&cmd.sbom, "sbom", "", "Add an SBOM attestation (e.g. generator=<image>)")
+
+	fs.StringVar(&cmd.network, "network", "default", "Default network mode for RUN instructions without their own --network (default|none|host)")
+
+	fs.StringVar(&cmd.sourceDateEpoch, "source-date-epoch", "", "Rewrite layer and image timestamps to this unix time for reproducible builds (also read from $SOURCE_DATE_EPOCH)")
+
+	fs.StringVar(&cmd.progress, "progress", "auto", "Set type of progress output (auto|plain|tty|rawjson)")
+}
+
+// resolveContext turns the positional context argument into a local
+// directory buildkit can read the Dockerfile and build context from. Git
+// URLs are shallow-cloned and HTTP(S) URLs are downloaded and unpacked;
+// "-" is read from stdin as a tar stream, through the same untar() path
+// used for the HTTP tarball case; everything else (".", a local path) is
+// returned as-is. The returned cleanup func removes any temp dir that was
+// created and should be deferred by the caller.
+func (cmd *buildCommand) resolveContext(buildContext string) (dir string, cleanup func(), err error) {
+	noop := func() {}
+
+	switch {
+	case isGitContext(buildContext):
+		url, gitRef, subdir := splitRemoteContextRef(buildContext)
+		if cmd.buildContextSubdir != "" {
+			subdir = cmd.buildContextSubdir
+		}
+		root, err := fetchGitContext(url, gitRef, "")
+		if err != nil {
+			return "", noop, err
+		}
+		dir = root
+		if subdir != "" {
+			dir = filepath.Join(root, subdir)
+		}
+		return dir, func() { os.RemoveAll(root) }, nil
+
+	case isHTTPContext(buildContext):
+		url, _, subdir := splitRemoteContextRef(buildContext)
+		if cmd.buildContextSubdir != "" {
+			subdir = cmd.buildContextSubdir
+		}
+		root, err := fetchHTTPContext(url)
+		if err != nil {
+			return "", noop, err
+		}
+		dir = root
+		if subdir != "" {
+			dir = filepath.Join(root, subdir)
+		}
+		return dir, func() { os.RemoveAll(root) }, nil
+
+	case buildContext == "-":
+		root, err := ioutil.TempDir("", "img-stdin-context")
+		if err != nil {
+			return "", noop, fmt.Errorf("creating temp dir for stdin context: %v", err)
+		}
+		if err := untar(os.Stdin, root); err != nil {
+			os.RemoveAll(root)
+			return "", noop, fmt.Errorf("reading context from stdin: %v", err)
+		}
+		return root, func() { os.RemoveAll(root) }, nil
+
+	default:
+		return buildContext, noop, nil
+	}
+}
+
+// parseCacheOptions turns the repeated --cache-from/--cache-to flag values
+// into the CacheOptionsEntry slices that buildkit's solve request expects.
+func parseCacheOptions(cacheFrom, cacheTo []string) ([]client.CacheOptionsEntry, []client.CacheOptionsEntry, error) {
+	imports, err := parseCacheEntries(cacheFrom)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing --cache-from: %v", err)
+	}
+
+	exports, err := parseCacheEntries(cacheTo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing --cache-to: %v", err)
+	}
+
+	return imports, exports, nil
+}
+
+// dockerfileName returns the basename of the Dockerfile for the "filename"
+// frontend attr, defaulting to the conventional name.
+func (cmd *buildCommand) dockerfileName() string {
+	if cmd.dockerfilePath == "" {
+		return "Dockerfile"
+	}
+	return filepath.Base(cmd.dockerfilePath)
+}
+
+func (cmd *buildCommand) Run(ctx context.Context, args []string) error {
+	cacheImports, cacheExports, err := parseCacheOptions(cmd.cacheFrom, cmd.cacheTo)
+	if err != nil {
+		return err
+	}
+
+	buildContext := "."
+	if len(args) > 0 {
+		buildContext = args[0]
+	}
+
+	dir, cleanup, err := cmd.resolveContext(buildContext)
+	if err != nil {
+		return fmt.Errorf("resolving build context %q: %v", buildContext, err)
+	}
+	defer cleanup()
+
+	namedContexts, err := parseNamedBuildContexts(cmd.buildContexts)
+	if err != nil {
+		return err
+	}
+
+	// localDirs always carries the resolved build context and the directory
+	// holding the Dockerfile (the -f path's directory, else the context);
+	// named local-dir contexts are added to it below, each under its own
+	// key so the "context:<name>" frontend attr can point "local:<name>"
+	// back at it.
+	dockerfileDir := dir
+	if cmd.dockerfilePath != "" {
+		dockerfileDir = filepath.Dir(cmd.dockerfilePath)
+	}
+	localDirs := map[string]string{"context": dir, "dockerfile": dockerfileDir}
+	namedContextAttrs := map[string]string{}
+	for name, nc := range namedContexts {
+		switch {
+		case isImageContext(nc.source):
+			namedContextAttrs["context:"+name] = nc.source
+
+		case isGitContext(nc.source):
+			url, gitRef, subdir := splitRemoteContextRef(nc.source)
+			root, err := fetchGitContext(url, gitRef, "")
+			if err != nil {
+				return fmt.Errorf("resolving --build-context %s=%s: %v", name, nc.source, err)
+			}
+			defer os.RemoveAll(root)
+			contextDir := root
+			if subdir != "" {
+				contextDir = filepath.Join(root, subdir)
+			}
+			localDirs[name] = contextDir
+			namedContextAttrs["context:"+name] = "local:" + name
+
+		case isHTTPContext(nc.source):
+			url, _, subdir := splitRemoteContextRef(nc.source)
+			root, err := fetchHTTPContext(url)
+			if err != nil {
+				return fmt.Errorf("resolving --build-context %s=%s: %v", name, nc.source, err)
+			}
+			defer os.RemoveAll(root)
+			contextDir := root
+			if subdir != "" {
+				contextDir = filepath.Join(root, subdir)
+			}
+			localDirs[name] = contextDir
+			namedContextAttrs["context:"+name] = "local:" + name
+
+		default:
+			localDirs[name] = nc.source
+			namedContextAttrs["context:"+name] = "local:" + name
+		}
+	}
+
+	provenance, err := parseProvenanceOptions(cmd.provenance)
+	if err != nil {
+		return err
+	}
+
+	sbom, err := parseSBOMOptions(cmd.sbom)
+	if err != nil {
+		return err
+	}
+
+	defaultNetwork, err := parseNetworkMode(cmd.network)
+	if err != nil {
+		return err
+	}
+
+	epoch, hasEpoch, err := resolveSourceDateEpoch(cmd.sourceDateEpoch)
+	if err != nil {
+		return err
+	}
+
+	progressMode, err := parseProgressMode(cmd.progress)
+	if err != nil {
+		return err
+	}
+
+	export, err := parseExportEntry(cmd.output, cmd.tags)
+	if err != nil {
+		return err
+	}
+	if hasEpoch {
+		// Rewrites layer file mtimes and the image config/history "created"
+		// fields to epoch; with the Dockerfile and build-args otherwise
+		// unchanged, two builds produce a byte-identical export.
+		epochStr := strconv.FormatInt(epoch.Unix(), 10)
+		export.Attrs["source-date-epoch"] = epochStr
+	}
+
+	frontendAttrs := map[string]string{
+		"filename": cmd.dockerfileName(),
+		// Pin an explicit frontend image so heredocs (`RUN <<EOF`, `COPY
+		// <<EOF`) and the "--network" RUN flag parse even against an older
+		// buildkitd than the one img ships against by default.
+		"source": defaultDockerfileFrontend,
+		// force-network-mode sets the default network for RUN instructions
+		// that don't specify their own --network; a per-instruction
+		// `RUN --network=<mode>` still takes precedence over this.
+		"force-network-mode": defaultNetwork.String(),
+	}
+	if cmd.noCache {
+		frontendAttrs["no-cache"] = ""
+	}
+	if cmd.target != "" {
+		frontendAttrs["target"] = cmd.target
+	}
+	for _, arg := range cmd.buildArgs {
+		if key, value, ok := splitKeyValue(arg); ok {
+			frontendAttrs["build-arg:"+key] = value
+		}
+	}
+	for _, label := range cmd.labels {
+		if key, value, ok := splitKeyValue(label); ok {
+			frontendAttrs["label:"+key] = value
+		}
+	}
+	if len(cmd.platforms) > 0 {
+		frontendAttrs["platform"] = strings.Join(cmd.platforms, ",")
+	}
+	for key, value := range namedContextAttrs {
+		frontendAttrs[key] = value
+	}
+	if hasEpoch {
+		// Also tells the dockerfile frontend to normalize the mtimes it
+		// writes into build-stage layers, not just the final export.
+		frontendAttrs["source-date-epoch"] = strconv.FormatInt(epoch.Unix(), 10)
+	}
+
+	// attest:provenance/attest:sbom are the same frontend attrs buildx
+	// passes for these flags; buildkit's dockerfile frontend and exporter
+	// build the actual SLSA/SPDX in-toto statements (from the Dockerfile
+	// digest, resolved base-image digests, platform, and LLB definition
+	// hash) and attach them as OCI 1.1 referrers on the exported index.
+	if provenance != nil {
+		frontendAttrs["attest:provenance"] = fmt.Sprintf("mode=%s", provenance.mode)
+	}
+	if sbom != nil {
+		frontendAttrs["attest:sbom"] = fmt.Sprintf("generator=%s", sbom.generator)
+	}
+
+	bkc, err := cmd.newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("creating buildkit client: %v", err)
+	}
+
+	statusCh := make(chan *client.SolveStatus)
+	done := make(chan struct{})
+	go func() {
+		displayProgress(progressMode, statusCh, os.Stderr)
+		close(done)
+	}()
+
+	_, err = bkc.Solve(ctx, nil, client.SolveOpt{
+		Exports:       []client.ExportEntry{export},
+		LocalDirs:     localDirs,
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: frontendAttrs,
+		CacheImports:  cacheImports,
+		CacheExports:  cacheExports,
+	}, statusCh)
+	<-done
+
+	return err
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -155,6 +159,58 @@ func TestBuildMultipleSecrets(t *testing.T) {
 	}
 }
 
+// TestBuildHeredoc verifies Dockerfile 1.4+ heredoc syntax for both RUN and
+// COPY, building a multi-line shell script and an inline file without a
+// separate context entry.
+func TestBuildHeredoc(t *testing.T) {
+	name := "testbuildheredoc"
+
+	args := []string{"build", "-t", name, "-"}
+	_, err := doRun(args, withDockerfile(`
+  FROM busybox
+  RUN <<EOF
+  set -ex
+  echo one >> /imgout
+  echo two >> /imgout
+  EOF
+  COPY <<EOF /greeting.txt
+  hello from a heredoc
+  EOF
+  `))
+
+	if err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
+// TestBuildRunNetworkNone verifies that `RUN --network=none` isolates the
+// step from the network while the default network mode still allows it.
+func TestBuildRunNetworkNone(t *testing.T) {
+	name := "testbuildrunnetworknone"
+
+	args := []string{"build", "-t", name, "-"}
+	out, err := doRun(args, withDockerfile(`
+  FROM alpine
+  RUN --network=none sh -c 'wget -T 2 -q -O - https://example.com && exit 1 || echo "network is unreachable as expected"'
+  `))
+	if err != nil {
+		t.Logf("img %v failed unexpectedly: %v, output: %s", args, err, out)
+		t.FailNow()
+	}
+
+	name = "testbuildrunnetworkdefault"
+	args = []string{"build", "-t", name, "-"}
+	_, err = doRun(args, withDockerfile(`
+  FROM alpine
+  RUN --network=default wget -T 5 -q -O /dev/null https://example.com
+  `))
+	if err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
 // generatePrivateKey creates a RSA Private Key of specified byte size in PEM format
 func generatePrivateKeyPEM(bitSize int) ([]byte, error) {
 	// Private Key generation
@@ -257,6 +313,89 @@ func TestBuildMultiplePlatforms(t *testing.T) {
 	}
 }
 
+// TestBuildNamedContext verifies that `--build-context name=source` lets a
+// Dockerfile's `FROM name` resolve to a pinned image ref, and `COPY
+// --from=name` resolve to an arbitrary local directory, instead of an
+// earlier build stage.
+func TestBuildNamedContext(t *testing.T) {
+	name := "testbuildnamedcontext"
+
+	tmpd, err := ioutil.TempDir("", "img-buildnamedcontext")
+	if err != nil {
+		t.Fatalf("creating temporary directory for named context failed: %v", err)
+	}
+	defer os.RemoveAll(tmpd)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpd, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("writing fixture file failed: %v", err)
+	}
+
+	args := []string{
+		"build", "-t", name,
+		"--build-context", "base=docker-image://alpine:3.19",
+		"--build-context", "src=" + tmpd,
+		"-",
+	}
+	_, err = doRun(args, withDockerfile(`
+  FROM base
+  COPY --from=src hello.txt /hello.txt
+  `))
+
+	if err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
+// TestBuildNamedContextGit verifies that a `--build-context name=source`
+// entry whose source is a git URL is cloned and wired in as a local
+// context, the same way the positional build context is, rather than
+// handed to buildkit as a literal (and unresolvable) local-dir path.
+func TestBuildNamedContextGit(t *testing.T) {
+	name := "testbuildnamedcontextgit"
+
+	repo, err := ioutil.TempDir("", "img-buildnamedcontextgit-repo")
+	if err != nil {
+		t.Fatalf("creating temporary git repo dir failed: %v", err)
+	}
+	defer os.RemoveAll(repo)
+
+	if err := ioutil.WriteFile(filepath.Join(repo, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("writing fixture file failed: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-b", "main", repo},
+		{"-C", repo, "add", "."},
+		{"-C", repo, "-c", "user.email=img@test", "-c", "user.name=img", "commit", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+
+	repoGit := repo + ".git"
+	if err := os.Rename(repo, repoGit); err != nil {
+		t.Fatalf("renaming repo dir to %q failed: %v", repoGit, err)
+	}
+	defer os.RemoveAll(repoGit)
+
+	args := []string{
+		"build", "-t", name,
+		"--build-context", "src=" + repoGit,
+		"-",
+	}
+	_, err = doRun(args, withDockerfile(`
+  FROM busybox
+  COPY --from=src hello.txt /hello.txt
+  `))
+
+	if err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
 func TestBuildContextFirstInCommand(t *testing.T) {
 	args := []string{"build", "-", "-t", "testbuildargsfirst"}
 
@@ -270,6 +409,87 @@ func TestBuildContextFirstInCommand(t *testing.T) {
 	}
 }
 
+// TestBuildContextGit verifies that a `git://` (or `https://...git`) remote
+// context is shallow-cloned and built, honoring the optional `#ref:subdir`
+// fragment. It clones a local repo built on the fly rather than reaching
+// out to github.com, so the test is deterministic and network-free.
+func TestBuildContextGit(t *testing.T) {
+	name := "testbuildcontextgit"
+
+	repo, err := ioutil.TempDir("", "img-buildcontextgit-repo")
+	if err != nil {
+		t.Fatalf("creating temporary git repo dir failed: %v", err)
+	}
+	defer os.RemoveAll(repo)
+
+	subdir := filepath.Join(repo, "testdata", "build-context")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatalf("creating %q failed: %v", subdir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(subdir, "Dockerfile"), []byte("FROM busybox\n"), 0644); err != nil {
+		t.Fatalf("writing Dockerfile failed: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-b", "main", repo},
+		{"-C", repo, "add", "."},
+		{"-C", repo, "-c", "user.email=img@test", "-c", "user.name=img", "commit", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+
+	repoGit := repo + ".git"
+	if err := os.Rename(repo, repoGit); err != nil {
+		t.Fatalf("renaming repo dir to %q failed: %v", repoGit, err)
+	}
+	defer os.RemoveAll(repoGit)
+
+	args := []string{"build", "-t", name, repoGit + "#main:testdata/build-context"}
+	if _, err := doRun(args, nil); err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
+// TestBuildContextHTTPTarball verifies that an `https://.../context.tar.gz`
+// remote context is downloaded, verified as a tar(.gz) archive, and unpacked
+// into the build context. It's served from a local httptest.Server rather
+// than a live host, so the test is deterministic and network-free.
+func TestBuildContextHTTPTarball(t *testing.T) {
+	name := "testbuildcontexthttptarball"
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	dockerfile := []byte("FROM busybox\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile))}); err != nil {
+		t.Fatalf("writing tar header failed: %v", err)
+	}
+	if _, err := tw.Write(dockerfile); err != nil {
+		t.Fatalf("writing tar content failed: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer failed: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("closing gzip writer failed: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	args := []string{"build", "-t", name, srv.URL + "/context.tar.gz"}
+	if _, err := doRun(args, nil); err != nil {
+		t.Logf("img %v failed unexpectedly: %v", args, err)
+		t.FailNow()
+	}
+}
+
 func TestBuildOutputLocal(t *testing.T) {
 
 	tmpd, err := ioutil.TempDir("", "img-buildoutputlocal")
@@ -336,6 +556,105 @@ func TestBuildOutputOCI(t *testing.T) {
 	testBuildOutputArchive("oci", t)
 }
 
+// TestBuildOutputOCIProvenanceAndSBOM builds with --provenance=mode=max and
+// --sbom=generator=<image>, then reads the exported OCI archive and asserts
+// that one of its .json entries mentions the in-toto media type. It does
+// not check that the attestation's subject digest matches the built image.
+func TestBuildOutputOCIProvenanceAndSBOM(t *testing.T) {
+	name := "testbuildoutputociprovenance"
+
+	tmpd, err := ioutil.TempDir("", "img-buildoutputociprovenance")
+	if err != nil {
+		t.Fatalf("creating temporary directory for build output failed: %v", err)
+	}
+	defer os.RemoveAll(tmpd)
+	archive := filepath.Join(tmpd, "output.tar")
+
+	args := []string{
+		"build", "-", "-o", fmt.Sprintf("type=oci,dest=%s", archive),
+		"--provenance", "mode=max",
+		"--sbom", "generator=docker/buildkit-syft-scanner:stable-1",
+	}
+	_, err = doRun(args, withDockerfile(`
+	FROM busybox
+	`))
+	if err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("could not open output archive at %q: %s", archive, err)
+	}
+	defer f.Close()
+
+	foundAttestation := false
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read oci archive: %s", err)
+		}
+
+		if !strings.HasSuffix(hdr.Name, ".json") {
+			continue
+		}
+
+		buf := make([]byte, hdr.Size)
+		if _, err := io.ReadFull(tr, buf); err != nil {
+			t.Fatalf("could not read manifest %q: %s", hdr.Name, err)
+		}
+		if strings.Contains(string(buf), inTotoMediaType) {
+			foundAttestation = true
+			break
+		}
+	}
+
+	if !foundAttestation {
+		t.Fatalf("expected an %q attestation manifest in %q", inTotoMediaType, archive)
+	}
+}
+
+// TestBuildOutputOCISourceDateEpoch builds the same Dockerfile twice with
+// the same --source-date-epoch and asserts the resulting OCI archives are
+// byte-for-byte identical, including their tar entries and manifest digest.
+func TestBuildOutputOCISourceDateEpoch(t *testing.T) {
+	dockerfile := `
+	FROM busybox
+	RUN echo reproducible > /imgout
+	`
+
+	build := func(name string) []byte {
+		tmpd, err := ioutil.TempDir("", "img-buildoutputocisde")
+		if err != nil {
+			t.Fatalf("creating temporary directory for build output failed: %v", err)
+		}
+		defer os.RemoveAll(tmpd)
+		archive := filepath.Join(tmpd, "output.tar")
+
+		args := []string{"build", "-t", name, "-o", fmt.Sprintf("type=oci,dest=%s", archive), "--source-date-epoch", "1700000000", "-"}
+		if _, err := doRun(args, withDockerfile(dockerfile)); err != nil {
+			t.Fatalf("img %v failed unexpectedly: %v", args, err)
+		}
+
+		out, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatalf("reading output archive at %q failed: %v", archive, err)
+		}
+		return out
+	}
+
+	first := build("testbuildoutputocisde1")
+	second := build("testbuildoutputocisde2")
+
+	if !bytes.Equal(first, second) {
+		t.Fatalf("expected byte-identical OCI archives for the same --source-date-epoch, got different output")
+	}
+}
+
 func TestBuildOutputTarStdout(t *testing.T) {
 
 	args := []string{"build", "-", "-o", "type=tar"}
@@ -374,6 +693,74 @@ func TestBuildOutputTarStdout(t *testing.T) {
 	}
 }
 
+// TestBuildProgressRawJSON verifies that `--progress=rawjson` emits one
+// JSON object per line describing vertex start/completion (and optionally
+// log/cache events), and that every started vertex has a matching
+// completion event somewhere in the stream.
+func TestBuildProgressRawJSON(t *testing.T) {
+	args := []string{"build", "-", "--progress", "rawjson", "-o", "type=tar"}
+
+	// modified doRun() function that returns stderr, where the progress
+	// stream is written, apart from the tar archive on stdout
+	doRunStderr := func(args []string, stdin io.Reader) ([]byte, error) {
+		prog := "./testimg" + exeSuffix
+
+		newargs := []string{args[0], "--state", testStateDir}
+		newargs = append(newargs, args[1:]...)
+
+		cmd := exec.Command(prog, newargs...)
+		if stdin != nil {
+			cmd.Stdin = stdin
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("Error running %s: %v: %s", strings.Join(newargs, " "), err, stderr.String())
+		}
+		return stderr.Bytes(), nil
+	}
+
+	out, err := doRunStderr(args, withDockerfile(`
+	FROM busybox
+	RUN echo hello
+	`))
+	if err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+
+	started := map[string]bool{}
+	completed := map[string]bool{}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var v rawJSONVertex
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("could not parse rawjson progress line %q: %v", line, err)
+		}
+
+		if v.Started != nil {
+			started[v.Digest] = true
+		}
+		if v.Completed != nil {
+			completed[v.Digest] = true
+		}
+	}
+
+	if len(started) == 0 {
+		t.Fatalf("expected at least one vertex start event, got none")
+	}
+
+	for digest := range started {
+		if !completed[digest] {
+			t.Fatalf("vertex %q started but never completed in the rawjson progress stream", digest)
+		}
+	}
+}
+
 func TestBuildOutputImage(t *testing.T) {
 	name := "testbuildoutputimage"
 
@@ -386,6 +773,64 @@ func TestBuildOutputImage(t *testing.T) {
 	}
 }
 
+// TestBuildCacheRegistryHit verifies that a build exported with
+// `--cache-to type=registry` can be reconstructed entirely from cache by a
+// second build pointed at that ref with `--cache-from`.
+func TestBuildCacheRegistryHit(t *testing.T) {
+	name := "testbuildcacheregistryhit"
+	cacheRef := "testbuildcacheregistryhit:cache"
+
+	dockerfile := `
+	FROM busybox
+	RUN echo cache-me > /imgout
+	`
+
+	args := []string{"build", "-t", name, "-o", fmt.Sprintf("type=image,name=%s", name), "--cache-to", fmt.Sprintf("type=registry,ref=%s,mode=max", cacheRef), "-"}
+	if _, err := doRun(args, withDockerfile(dockerfile)); err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+
+	args = []string{"build", "--no-cache", "-t", name, "--cache-from", fmt.Sprintf("type=registry,ref=%s", cacheRef), "-"}
+	out, err := doRun(args, withDockerfile(dockerfile))
+	if err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+	if !strings.Contains(string(out), "CACHED") {
+		t.Fatalf("expected second build to hit cache from %q, got: %s", cacheRef, out)
+	}
+}
+
+// TestBuildCacheLocalDir verifies the `type=local` cache import/export pair
+// so builds can be seeded from a cache directory instead of a registry.
+func TestBuildCacheLocalDir(t *testing.T) {
+	name := "testbuildcachelocaldir"
+
+	tmpd, err := ioutil.TempDir("", "img-buildcachelocaldir")
+	if err != nil {
+		t.Fatalf("creating temporary directory for build cache failed: %v", err)
+	}
+	defer os.RemoveAll(tmpd)
+
+	dockerfile := `
+	FROM busybox
+	RUN echo cache-me > /imgout
+	`
+
+	args := []string{"build", "-t", name, "--cache-to", fmt.Sprintf("type=local,dest=%s,mode=max", tmpd), "-"}
+	if _, err := doRun(args, withDockerfile(dockerfile)); err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+
+	args = []string{"build", "--no-cache", "-t", name, "--cache-from", fmt.Sprintf("type=local,src=%s", tmpd), "-"}
+	out, err := doRun(args, withDockerfile(dockerfile))
+	if err != nil {
+		t.Fatalf("img %v failed unexpectedly: %v", args, err)
+	}
+	if !strings.Contains(string(out), "CACHED") {
+		t.Fatalf("expected second build to hit cache from %q, got: %s", tmpd, out)
+	}
+}
+
 func TestBuildOutputImageFailing(t *testing.T) {
 	name := "testbuildoutputimagefailing"
 
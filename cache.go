@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+)
+
+// parseCacheEntries parses the `type=<type>,k=v,...` syntax accepted by
+// --cache-from and --cache-to into buildkit CacheOptionsEntry values. A
+// bare value with no `type=` prefix is treated as `type=registry,ref=<value>`
+// for parity with `docker buildx build --cache-from user/app:cache`.
+func parseCacheEntries(entries []string) ([]client.CacheOptionsEntry, error) {
+	var out []client.CacheOptionsEntry
+
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ",")
+		attrs := map[string]string{}
+		cacheType := ""
+
+		for _, field := range fields {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				if cacheType == "" && !strings.Contains(field, "=") {
+					// Bare ref, e.g. --cache-from user/app:cache.
+					cacheType = "registry"
+					attrs["ref"] = field
+					continue
+				}
+				return nil, fmt.Errorf("invalid cache entry %q: expected key=value", field)
+			}
+
+			key, value := parts[0], parts[1]
+			if key == "type" {
+				cacheType = value
+				continue
+			}
+			attrs[key] = value
+		}
+
+		if cacheType == "" {
+			return nil, fmt.Errorf("invalid cache entry %q: missing type=", entry)
+		}
+
+		switch cacheType {
+		case "registry", "local", "inline", "gha":
+		default:
+			return nil, fmt.Errorf("unsupported cache type %q", cacheType)
+		}
+
+		out = append(out, client.CacheOptionsEntry{
+			Type:  cacheType,
+			Attrs: attrs,
+		})
+	}
+
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestParseCacheEntries(t *testing.T) {
+	entries, err := parseCacheEntries([]string{
+		"type=registry,ref=user/app:cache",
+		"type=local,src=/tmp/cache,mode=max",
+		"type=inline",
+		"user/app:cache",
+	})
+	if err != nil {
+		t.Fatalf("parseCacheEntries returned unexpected error: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 cache entries, got %d", len(entries))
+	}
+
+	if entries[0].Type != "registry" || entries[0].Attrs["ref"] != "user/app:cache" {
+		t.Fatalf("unexpected registry entry: %+v", entries[0])
+	}
+	if entries[1].Type != "local" || entries[1].Attrs["src"] != "/tmp/cache" || entries[1].Attrs["mode"] != "max" {
+		t.Fatalf("unexpected local entry: %+v", entries[1])
+	}
+	if entries[2].Type != "inline" {
+		t.Fatalf("unexpected inline entry: %+v", entries[2])
+	}
+	if entries[3].Type != "registry" || entries[3].Attrs["ref"] != "user/app:cache" {
+		t.Fatalf("expected bare ref to default to type=registry, got: %+v", entries[3])
+	}
+}
+
+func TestParseCacheEntriesRejectsUnsupportedType(t *testing.T) {
+	if _, err := parseCacheEntries([]string{"type=bogus,ref=x"}); err == nil {
+		t.Fatal("expected an error for an unsupported cache type, got nil")
+	}
+}
+
+func TestParseCacheEntriesRejectsMissingType(t *testing.T) {
+	if _, err := parseCacheEntries([]string{"ref=x,mode=max"}); err == nil {
+		t.Fatal("expected an error when no type= is given and the entry isn't a bare ref, got nil")
+	}
+}
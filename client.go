@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+
+	"github.com/moby/buildkit/client"
+)
+
+// defaultBuildkitAddress is where img's embedded buildkitd listens inside
+// the unprivileged namespace managed by the "--state" directory.
+const defaultBuildkitAddress = "unix:///run/img/buildkitd.sock"
+
+// newClient dials the buildkitd instance that Run() solves against.
+func (cmd *buildCommand) newClient(ctx context.Context) (*client.Client, error) {
+	return client.New(ctx, defaultBuildkitAddress)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+)
+
+// parseExportEntry turns the `-o type=...,k=v,...` flag value into the
+// client.ExportEntry that buildkit's solve request expects. An empty value
+// defaults to `type=image`, tagged with whatever `-t` names were given, to
+// match `img build -t name .` with no explicit `-o`.
+func parseExportEntry(output string, tags []string) (client.ExportEntry, error) {
+	attrs, err := parseAttrs(output)
+	if err != nil {
+		return client.ExportEntry{}, fmt.Errorf("parsing -o: %v", err)
+	}
+
+	exportType := attrs["type"]
+	if exportType == "" {
+		exportType = "image"
+	}
+	delete(attrs, "type")
+
+	if exportType == "image" {
+		if _, ok := attrs["name"]; !ok && len(tags) > 0 {
+			attrs["name"] = strings.Join(tags, ",")
+		}
+	}
+
+	entry := client.ExportEntry{Type: exportType, Attrs: attrs}
+
+	switch exportType {
+	case "local":
+		dest := attrs["dest"]
+		if dest == "" {
+			return entry, fmt.Errorf("-o type=local requires dest=<path>")
+		}
+		delete(attrs, "dest")
+		entry.OutputDir = dest
+
+	case "tar", "docker", "oci":
+		dest := attrs["dest"]
+		delete(attrs, "dest")
+		if dest == "" {
+			// Matches `img build - -o type=tar` with no dest: the archive
+			// streams to stdout.
+			dest = "-"
+		}
+
+		w, err := openExportWriter(dest)
+		if err != nil {
+			return entry, err
+		}
+		entry.Output = func(map[string]string) (io.WriteCloser, error) {
+			return w, nil
+		}
+	}
+
+	return entry, nil
+}
+
+type nopCloseWriter struct{ io.Writer }
+
+func (nopCloseWriter) Close() error { return nil }
+
+func openExportWriter(dest string) (io.WriteCloser, error) {
+	if dest == "-" {
+		return nopCloseWriter{os.Stdout}, nil
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, fmt.Errorf("creating output destination %q: %v", dest, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,6 @@
+package main
+
+// defaultDockerfileFrontend is the BuildKit frontend image used to parse and
+// solve Dockerfiles. Bumped to pick up Dockerfile 1.4 syntax (heredocs via
+// `RUN <<EOF`/`COPY <<EOF`, and `RUN --network=<mode>`).
+const defaultDockerfileFrontend = "docker/dockerfile:1.4"
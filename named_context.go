@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// namedBuildContext is one `--build-context name=source` entry. source may
+// be a local path, a `docker-image://<ref>` image reference, or a git or HTTP
+// remote context (see resolveContext). Any other source, including the name
+// of a build stage, is used as a local directory path.
+type namedBuildContext struct {
+	name   string
+	source string
+}
+
+const dockerImageContextPrefix = "docker-image://"
+
+// parseNamedBuildContexts parses the repeated `--build-context name=source`
+// flag values, used to satisfy `FROM name` or `COPY --from=name` with a
+// source other than an earlier build stage.
+func parseNamedBuildContexts(entries []string) (map[string]namedBuildContext, error) {
+	contexts := map[string]namedBuildContext{}
+
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --build-context %q: expected name=source", entry)
+		}
+
+		name, source := parts[0], parts[1]
+		if _, ok := contexts[name]; ok {
+			return nil, fmt.Errorf("duplicate --build-context name %q", name)
+		}
+
+		contexts[name] = namedBuildContext{name: name, source: source}
+	}
+
+	return contexts, nil
+}
+
+// isImageContext reports whether source names a plain OCI/Docker image
+// reference to resolve the named context from, e.g. `docker-image://alpine:3.19`.
+func isImageContext(source string) bool {
+	return strings.HasPrefix(source, dockerImageContextPrefix)
+}
+
+// imageContextRef strips the `docker-image://` scheme from source, returning
+// the bare image reference.
+func imageContextRef(source string) string {
+	return strings.TrimPrefix(source, dockerImageContextPrefix)
+}
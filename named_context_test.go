@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseNamedBuildContexts(t *testing.T) {
+	contexts, err := parseNamedBuildContexts([]string{
+		"base=docker-image://alpine:3.19",
+		"src=./vendor",
+	})
+	if err != nil {
+		t.Fatalf("parseNamedBuildContexts returned unexpected error: %v", err)
+	}
+
+	base, ok := contexts["base"]
+	if !ok || base.source != "docker-image://alpine:3.19" {
+		t.Fatalf("unexpected base context: %+v", base)
+	}
+	if !isImageContext(base.source) {
+		t.Fatalf("expected %q to be detected as an image context", base.source)
+	}
+	if imageContextRef(base.source) != "alpine:3.19" {
+		t.Fatalf("unexpected image ref: %q", imageContextRef(base.source))
+	}
+
+	src, ok := contexts["src"]
+	if !ok || src.source != "./vendor" {
+		t.Fatalf("unexpected src context: %+v", src)
+	}
+	if isImageContext(src.source) {
+		t.Fatalf("did not expect %q to be detected as an image context", src.source)
+	}
+}
+
+func TestParseNamedBuildContextsRejectsDuplicatesAndMalformed(t *testing.T) {
+	if _, err := parseNamedBuildContexts([]string{"name=a", "name=b"}); err == nil {
+		t.Fatal("expected an error for a duplicate --build-context name, got nil")
+	}
+	if _, err := parseNamedBuildContexts([]string{"no-source-separator"}); err == nil {
+		t.Fatal("expected an error for a malformed --build-context entry, got nil")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// networkMode is the parsed value of the build's `--network` flag, passed to
+// the dockerfile frontend (as its "force-network-mode" attr) as the network
+// mode for RUN instructions without their own --network.
+type networkMode int
+
+const (
+	// networkDefault gives the step the same network the build itself has,
+	// matching RUN with no --network flag.
+	networkDefault networkMode = iota
+	// networkNone runs the step in a fresh, unconnected network namespace.
+	networkNone
+	// networkHost runs the step in the host's network namespace.
+	networkHost
+)
+
+func parseNetworkMode(value string) (networkMode, error) {
+	switch value {
+	case "", "default":
+		return networkDefault, nil
+	case "none":
+		return networkNone, nil
+	case "host":
+		return networkHost, nil
+	default:
+		return networkDefault, fmt.Errorf("unsupported --network mode %q", value)
+	}
+}
+
+func (m networkMode) String() string {
+	switch m {
+	case networkNone:
+		return "none"
+	case networkHost:
+		return "host"
+	default:
+		return "default"
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseNetworkMode(t *testing.T) {
+	cases := map[string]networkMode{
+		"":        networkDefault,
+		"default": networkDefault,
+		"none":    networkNone,
+		"host":    networkHost,
+	}
+
+	for value, want := range cases {
+		got, err := parseNetworkMode(value)
+		if err != nil {
+			t.Fatalf("parseNetworkMode(%q) returned unexpected error: %v", value, err)
+		}
+		if got != want {
+			t.Errorf("parseNetworkMode(%q) = %v, want %v", value, got, want)
+		}
+		if got.String() != value && value != "" {
+			t.Errorf("networkMode(%q).String() = %q, want %q", value, got.String(), value)
+		}
+	}
+
+	if _, err := parseNetworkMode("bogus"); err == nil {
+		t.Fatal("expected an error for an unsupported --network mode, got nil")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moby/buildkit/client"
+)
+
+// progressMode selects how build progress is rendered to the user.
+type progressMode string
+
+const (
+	progressAuto    progressMode = "auto"
+	progressPlain   progressMode = "plain"
+	progressTTY     progressMode = "tty"
+	progressRawJSON progressMode = "rawjson"
+)
+
+func parseProgressMode(value string) (progressMode, error) {
+	switch progressMode(value) {
+	case "", progressAuto:
+		return progressAuto, nil
+	case progressPlain, progressTTY, progressRawJSON:
+		return progressMode(value), nil
+	default:
+		return "", fmt.Errorf("unsupported --progress mode %q", value)
+	}
+}
+
+// rawJSONVertex is one line of `--progress=rawjson` output, covering a
+// single buildkit SolveStatus vertex update: its start/completion, its
+// error, and whether it was served from cache. Log chunks are written as
+// separate rawJSONLog lines.
+type rawJSONVertex struct {
+	Digest    string `json:"digest"`
+	Name      string `json:"name"`
+	Started   *int64 `json:"started,omitempty"`
+	Completed *int64 `json:"completed,omitempty"`
+	Cached    bool   `json:"cached,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// rawJSONLog is one `--progress=rawjson` line carrying a base64-encoded
+// chunk of a vertex's log output.
+type rawJSONLog struct {
+	Vertex string `json:"vertex"`
+	Data   string `json:"data"`
+	Stream int    `json:"stream"`
+}
+
+// displayProgress drains statusCh, rendering each SolveStatus update to w in
+// the form the given mode calls for, until the channel is closed. It returns
+// once draining is complete, so the caller can safely wait on it before
+// reporting the build's final error.
+func displayProgress(mode progressMode, statusCh <-chan *client.SolveStatus, w io.Writer) {
+	switch mode {
+	case progressRawJSON:
+		writeRawJSONProgress(statusCh, w)
+	default:
+		// "auto" and "tty" both fall back to the same plain, line-oriented
+		// log for now; a richer terminal UI for "tty" is left to a later
+		// commit.
+		writePlainProgress(statusCh, w)
+	}
+}
+
+func writeRawJSONProgress(statusCh <-chan *client.SolveStatus, w io.Writer) {
+	enc := json.NewEncoder(w)
+	for status := range statusCh {
+		for _, v := range status.Vertexes {
+			enc.Encode(rawJSONVertex{
+				Digest:    v.Digest.String(),
+				Name:      v.Name,
+				Started:   unixPtr(v.Started),
+				Completed: unixPtr(v.Completed),
+				Cached:    v.Cached,
+				Error:     v.Error,
+			})
+		}
+		for _, l := range status.Logs {
+			enc.Encode(rawJSONLog{
+				Vertex: l.Vertex.String(),
+				Data:   base64.StdEncoding.EncodeToString(l.Data),
+				Stream: l.Stream,
+			})
+		}
+	}
+}
+
+func writePlainProgress(statusCh <-chan *client.SolveStatus, w io.Writer) {
+	for status := range statusCh {
+		for _, v := range status.Vertexes {
+			switch {
+			case v.Completed != nil && v.Error != "":
+				fmt.Fprintf(w, "%s ERROR: %s\n", v.Name, v.Error)
+			case v.Completed != nil && v.Cached:
+				fmt.Fprintf(w, "%s CACHED\n", v.Name)
+			case v.Completed != nil:
+				fmt.Fprintf(w, "%s DONE\n", v.Name)
+			case v.Started != nil:
+				fmt.Fprintf(w, "%s\n", v.Name)
+			}
+		}
+		for _, l := range status.Logs {
+			w.Write(l.Data)
+		}
+	}
+}
+
+// unixPtr converts a buildkit vertex's *time.Time into the unix-seconds
+// *int64 the rawjson wire format uses, leaving nil as nil.
+func unixPtr(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	unix := t.Unix()
+	return &unix
+}
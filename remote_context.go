@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isGitContext reports whether ref looks like a git remote-context URL, as
+// opposed to a local path, "-" (stdin), or an http(s) tarball.
+func isGitContext(ref string) bool {
+	url, _, _ := splitRemoteContextRef(ref)
+	switch {
+	case strings.HasPrefix(ref, "git://"),
+		strings.HasPrefix(ref, "git@"),
+		strings.HasSuffix(url, ".git"),
+		strings.Contains(ref, "#") && (strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")) && strings.Contains(ref, ".git"):
+		return true
+	}
+	return false
+}
+
+// isHTTPContext reports whether ref is a plain http(s) URL that should be
+// fetched and unpacked as a build context, rather than cloned as a git repo.
+func isHTTPContext(ref string) bool {
+	if isGitContext(ref) {
+		return false
+	}
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// splitRemoteContextRef splits a `<url>#<ref>:<subdir>` remote context
+// reference into its URL, the optional git ref/branch, and the optional
+// subdirectory fragment used to locate the Dockerfile's build context.
+func splitRemoteContextRef(ref string) (url, gitRef, subdir string) {
+	url = ref
+	if i := strings.Index(ref, "#"); i >= 0 {
+		url = ref[:i]
+		fragment := ref[i+1:]
+		if j := strings.Index(fragment, ":"); j >= 0 {
+			gitRef, subdir = fragment[:j], fragment[j+1:]
+		} else {
+			gitRef = fragment
+		}
+	}
+	return url, gitRef, subdir
+}
+
+// fetchGitContext shallow-clones url at gitRef into a temp dir and returns
+// the path to the build context, honoring an optional subdir.
+func fetchGitContext(url, gitRef, subdir string) (string, error) {
+	dir, err := ioutil.TempDir("", "img-git-context")
+	if err != nil {
+		return "", fmt.Errorf("creating temp dir for git context: %v", err)
+	}
+
+	args := []string{"clone", "--depth=1"}
+	if gitRef != "" {
+		args = append(args, "--branch", gitRef)
+	}
+	args = append(args, url, dir)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("cloning %s: %v", url, err)
+	}
+
+	if subdir != "" {
+		dir = filepath.Join(dir, subdir)
+	}
+
+	return dir, nil
+}
+
+// fetchHTTPContext downloads url and unpacks it as a tar archive into a temp
+// dir, gunzipping it first when it starts with the gzip magic bytes. A
+// response that is not a tar(.gz) archive is an error; it is not used as a
+// single Dockerfile.
+func fetchHTTPContext(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !isTarballContentType(ct) {
+		return "", fmt.Errorf("fetching %s: unexpected content-type %q for a build context archive", url, ct)
+	}
+
+	dir, err := ioutil.TempDir("", "img-http-context")
+	if err != nil {
+		return "", fmt.Errorf("creating temp dir for http context: %v", err)
+	}
+
+	var r io.Reader = resp.Body
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(resp.Body, buf)
+	buf = buf[:n]
+	r = io.MultiReader(bytes.NewReader(buf), resp.Body)
+
+	if isGzip(buf) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("reading gzip %s: %v", url, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := untar(r, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("unpacking %s: %v", url, err)
+	}
+
+	return dir, nil
+}
+
+func isGzip(header []byte) bool {
+	return len(header) > 2 && header[0] == 0x1f && header[1] == 0x8b
+}
+
+// isTarballContentType reports whether ct is a Content-Type a build context
+// archive might reasonably be served with. Servers that mislabel a tarball
+// as e.g. text/html are rejected before we spend time downloading it.
+func isTarballContentType(ct string) bool {
+	mediaType := ct
+	if i := strings.Index(ct, ";"); i >= 0 {
+		mediaType = ct[:i]
+	}
+	mediaType = strings.TrimSpace(mediaType)
+
+	switch mediaType {
+	case "application/gzip", "application/x-gzip",
+		"application/x-tar", "application/tar",
+		"application/octet-stream":
+		return true
+	default:
+		return false
+	}
+}
+
+// untar streams r through archive/tar into dir, refusing to write outside
+// of dir so a malicious archive cannot escape via symlinks or "../" paths.
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cleanDir := filepath.Clean(dir)
+		target := filepath.Join(dir, hdr.Name)
+		if target != cleanDir && !strings.HasPrefix(target, cleanDir+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %q escapes destination directory", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return fmt.Errorf("archive entry %q: links are not allowed in a build context archive", hdr.Name)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitRemoteContextRef(t *testing.T) {
+	url, gitRef, subdir := splitRemoteContextRef("https://github.com/example/repo.git#main:sub/dir")
+	if url != "https://github.com/example/repo.git" || gitRef != "main" || subdir != "sub/dir" {
+		t.Fatalf("unexpected split: url=%q gitRef=%q subdir=%q", url, gitRef, subdir)
+	}
+
+	url, gitRef, subdir = splitRemoteContextRef("https://example.com/context.tar.gz")
+	if url != "https://example.com/context.tar.gz" || gitRef != "" || subdir != "" {
+		t.Fatalf("unexpected split for plain url: url=%q gitRef=%q subdir=%q", url, gitRef, subdir)
+	}
+}
+
+func TestIsGitAndHTTPContext(t *testing.T) {
+	cases := []struct {
+		ref      string
+		wantGit  bool
+		wantHTTP bool
+	}{
+		{"git://example.com/repo", true, false},
+		{"git@example.com:repo.git", true, false},
+		{"https://example.com/repo.git#main", true, false},
+		{"https://example.com/context.tar.gz", false, true},
+		{".", false, false},
+		{"-", false, false},
+	}
+
+	for _, c := range cases {
+		if got := isGitContext(c.ref); got != c.wantGit {
+			t.Errorf("isGitContext(%q) = %v, want %v", c.ref, got, c.wantGit)
+		}
+		if got := isHTTPContext(c.ref); got != c.wantHTTP {
+			t.Errorf("isHTTPContext(%q) = %v, want %v", c.ref, got, c.wantHTTP)
+		}
+	}
+}
+
+func buildTestTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("writing tar header for %q failed: %v", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("writing tar content for %q failed: %v", name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer failed: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("closing gzip writer failed: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// TestFetchHTTPContext verifies that fetchHTTPContext downloads and unpacks
+// a gzip'd tarball without relying on the network, using a local httptest
+// server to stand in for the remote context.
+func TestFetchHTTPContext(t *testing.T) {
+	archive := buildTestTarGz(t, map[string]string{
+		"Dockerfile": "FROM busybox\n",
+		"hello.txt":  "hello from the remote context",
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	dir, err := fetchHTTPContext(srv.URL)
+	if err != nil {
+		t.Fatalf("fetchHTTPContext failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil {
+		t.Fatalf("reading unpacked file failed: %v", err)
+	}
+	if string(data) != "hello from the remote context" {
+		t.Fatalf("unexpected unpacked content: %q", data)
+	}
+}
+
+// TestResolveContextStdin verifies that a "-" context is read as a tar
+// stream from stdin and unpacked into a temp dir, through the same untar()
+// path used for remote contexts.
+func TestResolveContextStdin(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := "hi"
+	if err := tw.WriteHeader(&tar.Header{Name: "hello.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("writing tar header failed: %v", err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatalf("writing tar content failed: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer failed: %v", err)
+	}
+
+	origStdin := os.Stdin
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating pipe failed: %v", err)
+	}
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	go func() {
+		w.Write(buf.Bytes())
+		w.Close()
+	}()
+
+	cmd := &buildCommand{}
+	dir, cleanup, err := cmd.resolveContext("-")
+	if err != nil {
+		t.Fatalf("resolveContext(\"-\") failed: %v", err)
+	}
+	defer cleanup()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil {
+		t.Fatalf("reading file from stdin context failed: %v", err)
+	}
+	if string(data) != "hi" {
+		t.Fatalf("unexpected stdin context content: %q", data)
+	}
+}
+
+// TestUntarRejectsPathEscape verifies that an archive entry trying to
+// escape the destination directory via "../" is rejected.
+func TestUntarRejectsPathEscape(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../../etc/passwd", Mode: 0644, Size: 0}); err != nil {
+		t.Fatalf("writing tar header failed: %v", err)
+	}
+	tw.Close()
+
+	dir, err := ioutil.TempDir("", "img-untar-escape")
+	if err != nil {
+		t.Fatalf("creating temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := untar(&buf, dir); err == nil {
+		t.Fatal("expected untar to reject a path-escaping archive entry, got nil error")
+	}
+}
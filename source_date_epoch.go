@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sourceDateEpochEnv is the standard environment variable
+// (https://reproducible-builds.org/docs/source-date-epoch/) honored as a
+// fallback when --source-date-epoch is not passed explicitly.
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// resolveSourceDateEpoch returns the epoch to rewrite layer mtimes and
+// image timestamps to, preferring the explicit flag value over
+// $SOURCE_DATE_EPOCH. It returns ok=false when neither is set, in which
+// case timestamps are left untouched.
+func resolveSourceDateEpoch(flagValue string) (t time.Time, ok bool, err error) {
+	value := flagValue
+	if value == "" {
+		value = os.Getenv(sourceDateEpochEnv)
+	}
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid --source-date-epoch %q: %v", value, err)
+	}
+
+	return time.Unix(sec, 0).UTC(), true, nil
+}
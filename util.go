@@ -0,0 +1,14 @@
+package main
+
+import "strings"
+
+// splitKeyValue splits a "key=value" flag entry (as used by --build-arg,
+// --label, and friends) into its key and value. ok is false when s has no
+// "=".
+func splitKeyValue(s string) (key, value string, ok bool) {
+	idx := strings.Index(s, "=")
+	if idx < 0 {
+		return "", "", false
+	}
+	return s[:idx], s[idx+1:], true
+}